@@ -1,51 +1,242 @@
 package crawler
 
 import (
+	"encoding/json"
 	"io"
-	"log"
 	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
+// urlElementMatches lists the element/attribute pairs that hold a single
+// URL each.
+var urlElementMatches = [][]string{
+	{"a", "href"},
+	{"img", "src"},
+	{"link", "href"},
+	{"script", "src"},
+	{"source", "src"},
+	{"video", "src"},
+	{"audio", "src"},
+	{"iframe", "src"},
+	{"form", "action"},
+}
+
+// cssURLPattern matches a CSS url(...) reference, with or without quotes.
+var cssURLPattern = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// URLErrors collects the errors encountered while extracting URLs from a
+// single document, one per malformed URL found. A single bad URL no
+// longer aborts extraction; everything else in the document is still
+// returned alongside the accumulated errors.
+type URLErrors []error
+
+func (errs URLErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// ExtractURLs walks an HTML document for every URL it references: plain
+// href/src/action attributes, srcset candidate lists, <meta
+// http-equiv=refresh>, inline style="" background images and url(...)
+// references inside <style> blocks. URLs are resolved against the
+// document's <base href> (falling back to host), have their fragment
+// stripped, their host lowercased and their query parameters sorted, then
+// are returned if they belong to host. Malformed URLs are collected into
+// the returned URLErrors rather than aborting extraction.
 func ExtractURLs(body io.Reader, host string) ([]string, error) {
 	urls := []string{}
+	errs := URLErrors{}
 
 	document, err := goquery.NewDocumentFromReader(body)
 	if err != nil {
-		return urls, err
+		return urls, append(errs, err)
 	}
 
-	urlElementMatches := [][]string{
-		[]string{"a", "href"},
-		[]string{"img", "src"},
-		[]string{"link", "href"},
-		[]string{"script", "src"},
+	base := baseURL(document, host)
+
+	add := func(raw string) {
+		if raw == "" {
+			return
+		}
+
+		normalized, err := normalizeURL(raw, base)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		if normalized.Host == host {
+			urls = append(urls, normalized.String())
+		}
 	}
 
-	for _, attr := range urlElementMatches {
-		element, attr := attr[0], attr[1]
-		urls = append(urls, findByElementAttribute(document, host, element, attr)...)
+	for _, pair := range urlElementMatches {
+		element, attr := pair[0], pair[1]
+		document.Find(element).Each(func(_ int, selection *goquery.Selection) {
+			add(selection.AttrOr(attr, ""))
+		})
 	}
 
-	return urls, err
-}
+	document.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		for _, candidate := range parseSrcset(selection.AttrOr("srcset", "")) {
+			add(candidate)
+		}
+	})
 
-func findByElementAttribute(document *goquery.Document, host string, element string, attr string) []string {
-	urls := []string{}
+	document.Find("meta[http-equiv]").Each(func(_ int, selection *goquery.Selection) {
+		if !strings.EqualFold(selection.AttrOr("http-equiv", ""), "refresh") {
+			return
+		}
 
-	document.Find(element).Each(func(_ int, element *goquery.Selection) {
-		href, exists := element.Attr(attr)
+		if refreshURL, ok := parseMetaRefresh(selection.AttrOr("content", "")); ok {
+			add(refreshURL)
+		}
+	})
 
-		u, err := url.Parse(href)
-		if err != nil {
-			log.Fatal(err)
+	document.Find("[style]").Each(func(_ int, selection *goquery.Selection) {
+		for _, match := range cssURLPattern.FindAllStringSubmatch(selection.AttrOr("style", ""), -1) {
+			add(match[1])
 		}
+	})
 
-		if exists && u.Host == host {
-			urls = append(urls, href)
+	document.Find("style").Each(func(_ int, selection *goquery.Selection) {
+		for _, match := range cssURLPattern.FindAllStringSubmatch(selection.Text(), -1) {
+			add(match[1])
 		}
 	})
 
+	document.Find(`script[type="application/ld+json"]`).Each(func(_ int, selection *goquery.Selection) {
+		for _, candidate := range jsonLDURLs(selection.Text()) {
+			add(candidate)
+		}
+	})
+
+	if len(errs) == 0 {
+		return urls, nil
+	}
+
+	return urls, errs
+}
+
+// baseURL returns the document's <base href> if it declares one and it
+// parses, otherwise a URL built from host that relative references can
+// be resolved against.
+func baseURL(document *goquery.Document, host string) *url.URL {
+	if href, exists := document.Find("base[href]").First().Attr("href"); exists {
+		if parsed, err := url.Parse(href); err == nil {
+			return parsed
+		}
+	}
+
+	return &url.URL{Scheme: "https", Host: host}
+}
+
+// normalizeURL resolves raw against base, strips its fragment, lowercases
+// its host and sorts its query parameters.
+func normalizeURL(raw string, base *url.URL) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := base.ResolveReference(parsed)
+	resolved.Fragment = ""
+	resolved.Host = strings.ToLower(resolved.Host)
+
+	if resolved.RawQuery != "" {
+		if query, err := url.ParseQuery(resolved.RawQuery); err == nil {
+			resolved.RawQuery = query.Encode()
+		}
+	}
+
+	return resolved, nil
+}
+
+// matchesHost resolves raw against a synthetic https://host/ base and
+// normalizes it the same way ExtractURLs does, then reports whether its
+// host component is actually host rather than merely containing it as a
+// substring (e.g. "gov.uk.attacker.net" must not match "gov.uk").
+func matchesHost(raw string, host string) (string, bool) {
+	normalized, err := normalizeURL(raw, &url.URL{Scheme: "https", Host: host})
+	if err != nil {
+		return "", false
+	}
+
+	return normalized.String(), normalized.Host == host
+}
+
+// parseSrcset extracts the URL from each candidate in a srcset attribute,
+// discarding the width/density descriptor that follows it.
+func parseSrcset(srcset string) []string {
+	candidates := []string{}
+
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			candidates = append(candidates, fields[0])
+		}
+	}
+
+	return candidates
+}
+
+// parseMetaRefresh pulls the target URL out of a <meta http-equiv=refresh
+// content="..."> attribute, e.g. "5; url=https://example.com/".
+func parseMetaRefresh(content string) (string, bool) {
+	parts := strings.SplitN(content, ";", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	field := strings.TrimSpace(parts[1])
+	if !strings.HasPrefix(strings.ToLower(field), "url=") {
+		return "", false
+	}
+
+	value := strings.TrimSpace(field[len("url="):])
+	value = strings.Trim(value, `"'`)
+
+	return value, value != ""
+}
+
+// jsonLDURLs walks a <script type="application/ld+json"> block's parsed
+// JSON, collecting the value of every "url" and "@id" field. Invalid
+// JSON-LD is ignored rather than treated as an extraction error, since
+// it's not itself a URL.
+func jsonLDURLs(raw string) []string {
+	var data interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil
+	}
+
+	urls := []string{}
+	walkJSONLD(data, &urls)
+
 	return urls
-}
\ No newline at end of file
+}
+
+func walkJSONLD(node interface{}, urls *[]string) {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if key == "url" || key == "@id" {
+				if s, ok := field.(string); ok {
+					*urls = append(*urls, s)
+				}
+			}
+
+			walkJSONLD(field, urls)
+		}
+	case []interface{}:
+		for _, item := range value {
+			walkJSONLD(item, urls)
+		}
+	}
+}
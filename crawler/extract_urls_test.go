@@ -0,0 +1,62 @@
+package crawler_test
+
+import (
+	"strings"
+
+	. "github.com/alphagov/govuk_crawler_worker/crawler"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractURLs", func() {
+	host := "www.gov.uk"
+
+	It("extracts srcset candidates, discarding their width/density descriptors", func() {
+		html := `<html><body>
+			<img src="fallback.jpg" srcset="https://www.gov.uk/one.jpg 1x, https://www.gov.uk/two.jpg 2x">
+		</body></html>`
+
+		urls, err := ExtractURLs(strings.NewReader(html), host)
+
+		Expect(err).To(BeNil())
+		Expect(urls).To(ContainElement("https://www.gov.uk/one.jpg"))
+		Expect(urls).To(ContainElement("https://www.gov.uk/two.jpg"))
+	})
+
+	It("resolves relative URLs against a declared <base href>", func() {
+		html := `<html><head><base href="https://www.gov.uk/guidance/"></head>
+			<body><a href="page">link</a></body></html>`
+
+		urls, err := ExtractURLs(strings.NewReader(html), host)
+
+		Expect(err).To(BeNil())
+		Expect(urls).To(ContainElement("https://www.gov.uk/guidance/page"))
+	})
+
+	It("rejects hosts that merely contain the target host as a substring", func() {
+		html := `<html><body>
+			<a href="https://www.gov.uk.attacker.net/phish">evil</a>
+			<a href="https://www.gov.uk/safe">safe</a>
+		</body></html>`
+
+		urls, err := ExtractURLs(strings.NewReader(html), host)
+
+		Expect(err).To(BeNil())
+		Expect(urls).To(ConsistOf("https://www.gov.uk/safe"))
+	})
+
+	It("accumulates one error per malformed URL rather than aborting extraction", func() {
+		html := `<html><body>
+			<a href="https://www.gov.uk/good">good</a>
+			<a href="https://www.gov.uk/bad%zz">bad</a>
+		</body></html>`
+
+		urls, err := ExtractURLs(strings.NewReader(html), host)
+
+		Expect(err).ToNot(BeNil())
+		Expect(err).To(BeAssignableToTypeOf(URLErrors{}))
+		Expect(err.(URLErrors)).To(HaveLen(1))
+		Expect(urls).To(ContainElement("https://www.gov.uk/good"))
+	})
+})
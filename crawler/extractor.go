@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"io"
+	"mime"
+	"strings"
+)
+
+// Extractor pulls every URL belonging to host out of a fetched response
+// body. ExtractorFor chooses which Extractor applies based on the
+// response's Content-Type.
+type Extractor interface {
+	Extract(body io.Reader, host string) ([]string, error)
+}
+
+// ExtractorFunc adapts a plain function to the Extractor interface.
+type ExtractorFunc func(body io.Reader, host string) ([]string, error)
+
+func (f ExtractorFunc) Extract(body io.Reader, host string) ([]string, error) {
+	return f(body, host)
+}
+
+var htmlExtractor Extractor = ExtractorFunc(ExtractURLs)
+
+// extractorsByMIMEType maps a response's MIME type (Content-Type minus
+// any parameters) to the Extractor used to find URLs in it.
+var extractorsByMIMEType = map[string]Extractor{
+	"text/html":             htmlExtractor,
+	"application/xhtml+xml": htmlExtractor,
+	"text/xml":              ExtractorFunc(ExtractSitemapURLs),
+	"application/xml":       ExtractorFunc(ExtractSitemapURLs),
+	"application/rss+xml":   ExtractorFunc(ExtractFeedURLs),
+	"application/atom+xml":  ExtractorFunc(ExtractFeedURLs),
+	"application/pdf":       ExtractorFunc(ExtractPDFURLs),
+}
+
+// ExtractorFor chooses the Extractor to run against a fetched response
+// based on its Content-Type header, defaulting to the HTML extractor for
+// anything unrecognised.
+func ExtractorFor(contentType string) Extractor {
+	mimeType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mimeType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+
+	if extractor, ok := extractorsByMIMEType[strings.ToLower(mimeType)]; ok {
+		return extractor
+	}
+
+	return htmlExtractor
+}
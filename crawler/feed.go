@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+)
+
+// feed mirrors just enough of RSS 2.0 and Atom to find each entry's link:
+// RSS uses a <link> text node, Atom uses <link href="...">.
+type feed struct {
+	Channel struct {
+		Items []struct {
+			Link string `xml:"link"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	Entries []struct {
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// ExtractFeedURLs parses an RSS or Atom feed, returning every entry link
+// that belongs to host.
+func ExtractFeedURLs(body io.Reader, host string) ([]string, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var f feed
+	if err := xml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+
+	for _, item := range f.Channel.Items {
+		if normalized, ok := matchesHost(item.Link, host); ok {
+			urls = append(urls, normalized)
+		}
+	}
+
+	for _, entry := range f.Entries {
+		for _, link := range entry.Links {
+			href := link.Href
+			if href == "" {
+				href = link.Text
+			}
+
+			if normalized, ok := matchesHost(href, host); ok {
+				urls = append(urls, normalized)
+			}
+		}
+	}
+
+	return urls, nil
+}
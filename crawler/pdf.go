@@ -0,0 +1,30 @@
+package crawler
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+)
+
+// pdfURIPattern matches a PDF /URI (...) link annotation action.
+var pdfURIPattern = regexp.MustCompile(`/URI\s*\(([^)]*)\)`)
+
+// ExtractPDFURLs does a best-effort scan of a PDF's raw bytes for /URI
+// link annotations, without parsing PDF's object model. It catches links
+// added by ordinary authoring tools but can miss ones compressed inside
+// an object stream.
+func ExtractPDFURLs(body io.Reader, host string) ([]string, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	for _, match := range pdfURIPattern.FindAllStringSubmatch(string(data), -1) {
+		if normalized, ok := matchesHost(match[1], host); ok {
+			urls = append(urls, normalized)
+		}
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,210 @@
+package crawler
+
+import (
+	"bufio"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphagov/govuk_crawler_worker/ttl_hash_set"
+)
+
+// robotsRules holds the directives this crawler honours from a single
+// host's robots.txt, scoped to "User-agent: *".
+type robotsRules struct {
+	CrawlDelay time.Duration
+	Disallow   []string
+}
+
+// robotsKeyPrefix namespaces robots.txt rules within the shared
+// TTLHashSet, which a Scheduler's other callers may also be storing
+// unrelated keys in.
+const robotsKeyPrefix = "robots:"
+
+// robotsCache shares a host's robots.txt across the whole crawler fleet:
+// the parsed rules are cached in hashSet, which is backed by Redis, so
+// once one worker has fetched and stored a host's rules every other
+// worker reads the cached rules instead of refetching them. Workers that
+// look up the same host before any of them has stored its rules each
+// fetch robots.txt themselves; there is no lock across workers. Each
+// process also keeps its own in-memory copy to avoid a Redis round trip
+// on every lookup.
+type robotsCache struct {
+	hashSet *ttl_hash_set.TTLHashSet
+	client  *http.Client
+
+	mu    sync.Mutex
+	rules map[string]robotsRules
+}
+
+func newRobotsCache(hashSet *ttl_hash_set.TTLHashSet) *robotsCache {
+	return &robotsCache{
+		hashSet: hashSet,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		rules:   make(map[string]robotsRules),
+	}
+}
+
+// rulesFor returns the robots.txt rules for host, checking this
+// process's in-memory cache, then the shared Redis cache, before falling
+// back to fetching and parsing robots.txt itself.
+func (r *robotsCache) rulesFor(host string) (robotsRules, error) {
+	r.mu.Lock()
+	rules, ok := r.rules[host]
+	r.mu.Unlock()
+
+	if ok {
+		return rules, nil
+	}
+
+	if rules, ok, err := r.cached(host); err == nil && ok {
+		r.remember(host, rules)
+		return rules, nil
+	}
+
+	rules, err := r.fetch(host)
+	if err != nil {
+		return robotsRules{}, err
+	}
+
+	if err := r.hashSet.AddValue(robotsKeyPrefix+host, serializeRobotsRules(rules)); err != nil {
+		log.Printf("Couldn't cache robots.txt rules for %s in Redis: %s", host, err)
+	}
+
+	r.remember(host, rules)
+
+	return rules, nil
+}
+
+// cached reads host's rules from the shared Redis cache, if another
+// worker has already fetched and stored them.
+func (r *robotsCache) cached(host string) (robotsRules, bool, error) {
+	value, ok, err := r.hashSet.Value(robotsKeyPrefix + host)
+	if err != nil || !ok {
+		return robotsRules{}, false, err
+	}
+
+	return deserializeRobotsRules(value), true, nil
+}
+
+func (r *robotsCache) remember(host string, rules robotsRules) {
+	r.mu.Lock()
+	r.rules[host] = rules
+	r.mu.Unlock()
+}
+
+// serializeRobotsRules encodes rules as newline-separated text: the
+// Crawl-delay in seconds, followed by one Disallow path per line. It's
+// deliberately simple, since the only reader is deserializeRobotsRules.
+func serializeRobotsRules(rules robotsRules) string {
+	lines := make([]string, 0, len(rules.Disallow)+1)
+	lines = append(lines, strconv.FormatFloat(rules.CrawlDelay.Seconds(), 'f', -1, 64))
+	lines = append(lines, rules.Disallow...)
+
+	return strings.Join(lines, "\n")
+}
+
+func deserializeRobotsRules(raw string) robotsRules {
+	lines := strings.Split(raw, "\n")
+
+	rules := robotsRules{}
+	if len(lines) > 0 {
+		if seconds, err := strconv.ParseFloat(lines[0], 64); err == nil {
+			rules.CrawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if len(lines) > 1 {
+		rules.Disallow = lines[1:]
+	}
+
+	return rules
+}
+
+func (r *robotsCache) fetch(host string) (robotsRules, error) {
+	response, err := r.client.Get("http://" + host + "/robots.txt")
+	if err != nil {
+		return robotsRules{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return robotsRules{}, nil
+	}
+
+	return parseRobots(response.Body), nil
+}
+
+// parseRobots extracts the Crawl-delay and Disallow directives that apply
+// to all user agents. It's intentionally forgiving of malformed input,
+// since a broken robots.txt shouldn't stop the crawl.
+func parseRobots(body interface {
+	Read(p []byte) (int, error)
+}) robotsRules {
+	rules := robotsRules{}
+	scanner := bufio.NewScanner(body)
+	applies := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		field := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch field {
+		case "user-agent":
+			applies = value == "*"
+		case "crawl-delay":
+			if !applies {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				rules.CrawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "disallow":
+			if !applies || value == "" {
+				continue
+			}
+			rules.Disallow = append(rules.Disallow, value)
+		}
+	}
+
+	return rules
+}
+
+// allows reports whether path is permitted by the cached Disallow rules.
+func (rules robotsRules) allows(path string) bool {
+	for _, disallow := range rules.Disallow {
+		if strings.HasPrefix(path, disallow) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pathFor returns the path component used to evaluate robots.txt rules
+// for rawURL.
+func pathFor(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "/"
+	}
+
+	if parsed.Path == "" {
+		return "/"
+	}
+
+	return parsed.Path
+}
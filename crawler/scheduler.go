@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphagov/govuk_crawler_worker/ttl_hash_set"
+)
+
+// SchedulerConfig controls the politeness behaviour applied before URLs
+// discovered by ExtractURLs are published to the queue.
+type SchedulerConfig struct {
+	// CrawlDelay is the minimum gap between requests to a host, used
+	// when robots.txt doesn't specify its own Crawl-delay.
+	CrawlDelay time.Duration
+	// MaxHostConcurrency is the number of URLs for a single host that
+	// may be in flight (i.e. published but not yet budgeted for again)
+	// at once.
+	MaxHostConcurrency int
+}
+
+// DefaultSchedulerConfig matches the crawl-delay GOV.UK has historically
+// asked third-party crawlers to respect.
+var DefaultSchedulerConfig = SchedulerConfig{
+	CrawlDelay:         1 * time.Second,
+	MaxHostConcurrency: 2,
+}
+
+// Scheduler enforces a per-host crawl-delay and concurrency budget,
+// honouring any Crawl-delay and Disallow directives published in the
+// host's robots.txt. URLs that would exceed a host's budget are deferred
+// rather than dropped: callers retry Allow until it returns true. URLs
+// that robots.txt disallows are the exception (see Allow).
+type Scheduler struct {
+	config SchedulerConfig
+	robots *robotsCache
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewScheduler builds a Scheduler that caches robots.txt fetches in
+// hashSet, so a host's robots.txt rules are shared across the whole
+// crawler fleet rather than fetched by every worker (see robotsCache).
+func NewScheduler(config SchedulerConfig, hashSet *ttl_hash_set.TTLHashSet) *Scheduler {
+	if config.CrawlDelay == 0 {
+		config.CrawlDelay = DefaultSchedulerConfig.CrawlDelay
+	}
+	if config.MaxHostConcurrency == 0 {
+		config.MaxHostConcurrency = DefaultSchedulerConfig.MaxHostConcurrency
+	}
+
+	return &Scheduler{
+		config:  config,
+		robots:  newRobotsCache(hashSet),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow reports whether a URL for host may be published right now. When
+// it returns false, wait is how long the caller should sleep before
+// calling Allow again rather than discarding the URL. A false result with
+// a zero wait means robots.txt disallows rawURL's path, and calling Allow
+// again returns the same.
+func (s *Scheduler) Allow(rawURL string, host string) (allow bool, wait time.Duration) {
+	rules, err := s.robots.rulesFor(host)
+	if err == nil && !rules.allows(pathFor(rawURL)) {
+		return false, 0
+	}
+
+	return s.bucketFor(host, rules).take()
+}
+
+// Schedule blocks until host's budget allows rawURL to be published, then
+// calls publish. It never drops rawURL: a URL whose path robots.txt
+// disallows is the only case publish is skipped.
+func (s *Scheduler) Schedule(rawURL string, host string, publish func() error) error {
+	for {
+		allow, wait := s.Allow(rawURL, host)
+		if allow {
+			return publish()
+		}
+
+		if wait == 0 {
+			// Disallowed by robots.txt.
+			return nil
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+func (s *Scheduler) bucketFor(host string, rules robotsRules) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[host]
+	if !ok {
+		delay := s.config.CrawlDelay
+		if rules.CrawlDelay > 0 {
+			delay = rules.CrawlDelay
+		}
+
+		bucket = newTokenBucket(s.config.MaxHostConcurrency, delay)
+		s.buckets[host] = bucket
+	}
+
+	return bucket
+}
+
+// tokenBucket is a simple per-host token bucket: it starts full so a
+// burst of MaxHostConcurrency URLs can go out immediately, then
+// replenishes one token every delay.
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     int
+	capacity   int
+	delay      time.Duration
+	lastRefill time.Time
+}
+
+func newTokenBucket(capacity int, delay time.Duration) *tokenBucket {
+	return &tokenBucket{
+		tokens:     capacity,
+		capacity:   capacity,
+		delay:      delay,
+		lastRefill: time.Now(),
+	}
+}
+
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.tokens > 0 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, b.delay
+}
+
+func (b *tokenBucket) refill() {
+	elapsed := time.Since(b.lastRefill)
+	if elapsed < b.delay {
+		return
+	}
+
+	replenished := int(elapsed / b.delay)
+	b.tokens += replenished
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.lastRefill = b.lastRefill.Add(time.Duration(replenished) * b.delay)
+}
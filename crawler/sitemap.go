@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// maxSitemapIndexDepth bounds how many levels of nested sitemap indexes
+// ExtractSitemapURLs will follow, so a misconfigured sitemap index can't
+// recurse forever.
+const maxSitemapIndexDepth = 5
+
+// sitemapClient bounds how long fetchSitemap will wait on a nested
+// sitemap, matching the timeout robotsCache uses for robots.txt.
+var sitemapClient = &http.Client{Timeout: 10 * time.Second}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// ExtractSitemapURLs parses an XML sitemap or sitemap index, returning
+// every <loc> that belongs to host. Sitemap indexes are followed
+// recursively, fetching each nested sitemap, up to maxSitemapIndexDepth.
+func ExtractSitemapURLs(body io.Reader, host string) ([]string, error) {
+	return extractSitemapURLs(body, host, 0)
+}
+
+func extractSitemapURLs(body io.Reader, host string, depth int) ([]string, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(data, &index); err == nil && len(index.Sitemaps) > 0 {
+		return extractSitemapIndexURLs(index, host, depth)
+	}
+
+	var set urlSet
+	if err := xml.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	for _, entry := range set.URLs {
+		if normalized, ok := matchesHost(entry.Loc, host); ok {
+			urls = append(urls, normalized)
+		}
+	}
+
+	return urls, nil
+}
+
+func extractSitemapIndexURLs(index sitemapIndex, host string, depth int) ([]string, error) {
+	if depth >= maxSitemapIndexDepth {
+		return []string{}, nil
+	}
+
+	urls := []string{}
+	for _, sitemap := range index.Sitemaps {
+		if sitemap.Loc == "" {
+			continue
+		}
+
+		// Nested <loc> values come straight from the (possibly hostile)
+		// sitemap we just parsed, so only follow ones that actually
+		// belong to host rather than an attacker-controlled or internal
+		// address.
+		nestedURL, ok := matchesHost(sitemap.Loc, host)
+		if !ok {
+			continue
+		}
+
+		nested, err := fetchSitemap(nestedURL, host, depth+1)
+		if err != nil {
+			continue
+		}
+
+		urls = append(urls, nested...)
+	}
+
+	return urls, nil
+}
+
+func fetchSitemap(sitemapURL string, host string, depth int) ([]string, error) {
+	response, err := sitemapClient.Get(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return extractSitemapURLs(response.Body, host, depth)
+}
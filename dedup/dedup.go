@@ -0,0 +1,18 @@
+// Package dedup abstracts the storage the crawler uses to avoid
+// re-queuing URLs it has already seen.
+package dedup
+
+import "github.com/alphagov/govuk_crawler_worker/ttl_hash_set"
+
+// Set is the dedup backend interface. TTLHashSet is the canonical
+// Redis-backed implementation; TwoTier wraps one with an in-process LRU
+// cache to cut round-trips on hot URLs.
+type Set interface {
+	Add(key string) (bool, error)
+	Exists(key string) (bool, error)
+	TTL(key string) (int64, error)
+	Ping() (string, error)
+	Close() error
+}
+
+var _ Set = (*ttl_hash_set.TTLHashSet)(nil)
@@ -0,0 +1,146 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// TwoTier fronts a Set (normally a Redis-backed TTLHashSet) with a
+// bounded in-process LRU cache. Repeated Exists checks for hot URLs are
+// served locally instead of round-tripping to Redis, and Exists checks
+// for keys already cached locally keep working through brief Redis
+// outages; only "exists" results are cached, so any other Exists check
+// still returns the backend's error. Add still writes through to the
+// backend immediately, so dedup stays correct across a fleet of workers.
+type TwoTier struct {
+	backend  Set
+	capacity int
+	localTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// NewTwoTier wraps backend with an LRU cache holding at most capacity
+// keys, each trusted for localTTL. Callers should keep localTTL
+// comfortably shorter than the TTL configured on backend, so a cached
+// "exists" never outlives the fact it's caching.
+func NewTwoTier(backend Set, capacity int, localTTL time.Duration) *TwoTier {
+	return &TwoTier{
+		backend:  backend,
+		capacity: capacity,
+		localTTL: localTTL,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Add writes through to backend and purges key from the local cache,
+// since its TTL in the backend has just been reset.
+func (t *TwoTier) Add(key string) (bool, error) {
+	added, err := t.backend.Add(key)
+	if err != nil {
+		return false, err
+	}
+
+	t.Purge(key)
+
+	return added, nil
+}
+
+// Exists serves from the local LRU cache when possible, falling back to
+// backend and caching the result on a miss.
+func (t *TwoTier) Exists(key string) (bool, error) {
+	if t.cachedExists(key) {
+		return true, nil
+	}
+
+	exists, err := t.backend.Exists(key)
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		t.remember(key)
+	}
+
+	return exists, nil
+}
+
+func (t *TwoTier) TTL(key string) (int64, error) {
+	return t.backend.TTL(key)
+}
+
+func (t *TwoTier) Ping() (string, error) {
+	return t.backend.Ping()
+}
+
+func (t *TwoTier) Close() error {
+	return t.backend.Close()
+}
+
+// Purge evicts key from the local cache, if present, forcing the next
+// Exists check for it to consult backend.
+func (t *TwoTier) Purge(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.removeLocked(key)
+}
+
+func (t *TwoTier) cachedExists(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	element, ok := t.entries[key]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(element.Value.(*cacheEntry).expiresAt) {
+		t.removeLocked(key)
+		return false
+	}
+
+	t.order.MoveToFront(element)
+	return true
+}
+
+func (t *TwoTier) remember(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expiresAt := time.Now().Add(t.localTTL)
+
+	if element, ok := t.entries[key]; ok {
+		element.Value.(*cacheEntry).expiresAt = expiresAt
+		t.order.MoveToFront(element)
+		return
+	}
+
+	element := t.order.PushFront(&cacheEntry{key: key, expiresAt: expiresAt})
+	t.entries[key] = element
+
+	if t.order.Len() > t.capacity {
+		oldest := t.order.Back()
+		t.removeLocked(oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// removeLocked must be called with t.mu held.
+func (t *TwoTier) removeLocked(key string) {
+	element, ok := t.entries[key]
+	if !ok {
+		return
+	}
+
+	t.order.Remove(element)
+	delete(t.entries, key)
+}
@@ -1,17 +1,31 @@
 package queue
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
 
+// MaxPublishRetries is how many times PublishWithConfirm will republish a
+// message that the broker Nacks before giving up.
+const MaxPublishRetries = 3
+
+// publishRetryBackoff is the delay before the first republish attempt;
+// it doubles on each subsequent retry.
+const publishRetryBackoff = 100 * time.Millisecond
+
 type QueueConnection struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
 
-	ack  chan uint64
-	nack chan uint64
+	mu       sync.Mutex
+	pending  map[uint64]chan amqp.Confirmation
+	order    []uint64        // delivery tags awaiting confirmation, oldest first
+	returned map[uint64]bool // tags the broker has already Returned as unroutable
 }
 
 func NewQueueConnection(amqpURI string) (*QueueConnection, error) {
@@ -30,14 +44,93 @@ func NewQueueConnection(amqpURI string) (*QueueConnection, error) {
 		return nil, err
 	}
 
-	ack, nack := channel.NotifyConfirm(make(chan uint64, 1), make(chan uint64, 1))
-
-	return &QueueConnection{
+	queueConnection := &QueueConnection{
 		Connection: connection,
 		Channel:    channel,
-		ack:        ack,
-		nack:       nack,
-	}, nil
+		pending:    make(map[uint64]chan amqp.Confirmation),
+		returned:   make(map[uint64]bool),
+	}
+
+	// Unbuffered, and drained by a single dispatch goroutine below: the
+	// broker always emits a Return for tag N (if any) strictly before the
+	// Confirm for tag N, and an unbuffered channel forces dispatch to
+	// receive (and fully process) each one before the broker's next frame
+	// can be delivered at all. Two independently-scheduled goroutines each
+	// reading their own buffered channel can't be relied on to preserve
+	// that relative order, which previously let a Return be processed
+	// after the Confirm it was meant to fail.
+	confirms := channel.NotifyConfirm(make(chan amqp.Confirmation))
+	returns := channel.NotifyReturn(make(chan amqp.Return))
+
+	go queueConnection.dispatch(confirms, returns)
+
+	return queueConnection, nil
+}
+
+// dispatch is the sole reader of confirms and returns, so it's the only
+// place that correlates a Return with the Confirm that follows it; running
+// that correlation from two separate goroutines can't preserve the order
+// the broker sent them in (see NewQueueConnection).
+func (c *QueueConnection) dispatch(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for confirms != nil || returns != nil {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.handleReturn(r)
+		case confirmation, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			c.handleConfirm(confirmation)
+		}
+	}
+}
+
+// handleReturn marks the delivery a Return belongs to as unroutable, so
+// handleConfirm can fail it once its Ack arrives. An amqp.Return doesn't
+// carry the delivery tag it was published with, but it's guaranteed to
+// have been read (and this function to have returned) before the matching
+// Confirm is read, so the oldest still-unconfirmed tag in c.order is
+// guaranteed to be the one this Return belongs to.
+func (c *QueueConnection) handleReturn(r amqp.Return) {
+	log.Printf(
+		"Message returned as unroutable: exchange=%q routingKey=%q replyText=%q",
+		r.Exchange, r.RoutingKey, r.ReplyText)
+
+	c.mu.Lock()
+	if len(c.order) > 0 {
+		c.returned[c.order[0]] = true
+	}
+	c.mu.Unlock()
+}
+
+// handleConfirm delivers an ack/nack from the broker to whichever
+// PublishWithConfirm call is waiting on that delivery tag. A delivery the
+// broker has already Returned as unroutable is surfaced as a failure even
+// though the broker itself Acks it (a mandatory publish's Ack only means
+// "received", not "routed").
+func (c *QueueConnection) handleConfirm(confirmation amqp.Confirmation) {
+	c.mu.Lock()
+	result, ok := c.pending[confirmation.DeliveryTag]
+	delete(c.pending, confirmation.DeliveryTag)
+
+	if len(c.order) > 0 && c.order[0] == confirmation.DeliveryTag {
+		c.order = c.order[1:]
+	}
+
+	if c.returned[confirmation.DeliveryTag] {
+		delete(c.returned, confirmation.DeliveryTag)
+		confirmation.Ack = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		result <- confirmation
+	}
 }
 
 func (c *QueueConnection) Close() error {
@@ -98,13 +191,64 @@ func (c *QueueConnection) BindQueueToExchange(queueName string, exchangeName str
 		nil)  // arguments
 }
 
+// Publish is a convenience wrapper around PublishWithConfirm that waits
+// indefinitely for the broker to confirm the message.
 func (c *QueueConnection) Publish(exchangeName string, routingKey string, contentType string, body string) error {
-	defer publisherConfirm(c)
+	return c.PublishWithConfirm(context.Background(), exchangeName, routingKey, contentType, body)
+}
+
+// PublishWithConfirm publishes body to exchangeName/routingKey and blocks
+// until the broker confirms that specific delivery, ctx is done, or the
+// message has been nacked and republished MaxPublishRetries times.
+func (c *QueueConnection) PublishWithConfirm(ctx context.Context, exchangeName string, routingKey string, contentType string, body string) error {
+	backoff := publishRetryBackoff
 
-	return c.Channel.Publish(
+	for attempt := 0; ; attempt++ {
+		confirmation, err := c.publishAndWait(ctx, exchangeName, routingKey, contentType, body)
+		if err != nil {
+			return err
+		}
+
+		if confirmation.Ack {
+			return nil
+		}
+
+		if attempt >= MaxPublishRetries {
+			return fmt.Errorf(
+				"queue: broker nacked delivery tag %d after %d attempts",
+				confirmation.DeliveryTag, attempt+1)
+		}
+
+		log.Printf(
+			"Broker nacked delivery tag %d, republishing in %s (attempt %d/%d)",
+			confirmation.DeliveryTag, backoff, attempt+1, MaxPublishRetries)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+	}
+}
+
+// publishAndWait assigns the next delivery tag, publishes the message and
+// waits for its confirmation. GetNextPublishSeqNo and Publish are kept
+// under the same lock so concurrent callers can't race the broker into
+// confirming tags out of the order they were handed out.
+func (c *QueueConnection) publishAndWait(ctx context.Context, exchangeName string, routingKey string, contentType string, body string) (amqp.Confirmation, error) {
+	result := make(chan amqp.Confirmation, 1)
+
+	c.mu.Lock()
+	tag := c.Channel.GetNextPublishSeqNo()
+	c.pending[tag] = result
+	c.order = append(c.order, tag)
+
+	err := c.Channel.Publish(
 		exchangeName, // publish to an exchange
 		routingKey,   // routing to 0 or more queues
-		false,        // mandatory
+		true,         // mandatory
 		false,        // immediate
 		amqp.Publishing{
 			Headers:         amqp.Table{},
@@ -114,21 +258,23 @@ func (c *QueueConnection) Publish(exchangeName string, routingKey string, conten
 			DeliveryMode:    amqp.Persistent,
 			Priority:        0, // 0-9
 		})
-}
+	if err != nil {
+		delete(c.pending, tag)
+		c.order = c.order[:len(c.order)-1]
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		return amqp.Confirmation{}, err
+	}
 
-func publisherConfirm(c *QueueConnection) {
 	select {
-	case tag := <-c.ack:
-		log.Println("Acknowledge message publish:", tag)
-		err := c.Channel.Ack(tag, false)
-		if err != nil {
-			log.Fatal("Couldn't ack:", tag, err)
-		}
-	case tag := <-c.nack:
-		log.Println("Couldn't acknowledge message publish:", tag)
-		err := c.Channel.Nack(tag, false, true)
-		if err != nil {
-			log.Fatal("Couldn't nack:", tag, err)
-		}
+	case confirmation := <-result:
+		return confirmation, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return amqp.Confirmation{}, ctx.Err()
 	}
 }
@@ -0,0 +1,193 @@
+package ttl_hash_set
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Mode selects how a TTLHashSet connects to its backing Redis deployment.
+type Mode string
+
+const (
+	// ModeSingle talks to a single Redis instance.
+	ModeSingle Mode = "single"
+	// ModeSentinel discovers the current master via Redis Sentinel and
+	// follows failovers to whichever instance Sentinel promotes next.
+	ModeSentinel Mode = "sentinel"
+	// ModeCluster talks to a Redis Cluster, routing commands to the
+	// correct node by key slot.
+	ModeCluster Mode = "cluster"
+)
+
+// defaultTTL is how long a key persists after being Add()ed, i.e. how
+// long this crawler considers a URL "already seen".
+const defaultTTL = 30 * 24 * time.Hour
+
+// Config describes how to connect to the Redis deployment backing a
+// TTLHashSet. Addrs holds a single "host:port" for ModeSingle, the
+// sentinel addresses for ModeSentinel, or the cluster node addresses for
+// ModeCluster.
+type Config struct {
+	Mode           Mode
+	SentinelMaster string
+	Addrs          []string
+	Password       string
+	DB             int
+}
+
+// client is the subset of go-redis's API TTLHashSet depends on. It's
+// satisfied by *redis.Client, *redis.ClusterClient and the client
+// returned by redis.NewFailoverClient, which lets NewTTLHashSet stay
+// agnostic of which of those three it's holding.
+type client interface {
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	PTTL(ctx context.Context, key string) *redis.DurationCmd
+	Ping(ctx context.Context) *redis.StatusCmd
+	Close() error
+}
+
+type TTLHashSet struct {
+	prefix string
+	ttl    time.Duration
+	client client
+}
+
+// NewTTLHashSet connects to Redis according to config and returns a
+// TTLHashSet that namespaces every key under prefix.
+func NewTTLHashSet(prefix string, config Config) (*TTLHashSet, error) {
+	redisClient, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := redisClient.Ping(context.Background()).Err(); err != nil {
+		redisClient.Close()
+		return nil, err
+	}
+
+	return NewTTLHashSetWithClient(prefix, redisClient), nil
+}
+
+// NewTTLHashSetWithClient builds a TTLHashSet around an already-configured
+// client. It exists so the underlying Redis client is pluggable: tests
+// can substitute a fake, and callers that need options Config doesn't
+// expose can build their own *redis.Client, *redis.ClusterClient or
+// failover client and hand it in directly.
+func NewTTLHashSetWithClient(prefix string, redisClient client) *TTLHashSet {
+	return &TTLHashSet{
+		prefix: prefix,
+		ttl:    defaultTTL,
+		client: redisClient,
+	}
+}
+
+func newClient(config Config) (client, error) {
+	if len(config.Addrs) == 0 {
+		return nil, fmt.Errorf("ttl_hash_set: config.Addrs must have at least one address")
+	}
+
+	switch config.Mode {
+	case ModeSentinel:
+		if config.SentinelMaster == "" {
+			return nil, fmt.Errorf("ttl_hash_set: config.SentinelMaster is required in sentinel mode")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    config.SentinelMaster,
+			SentinelAddrs: config.Addrs,
+			Password:      config.Password,
+			DB:            config.DB,
+		}), nil
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    config.Addrs,
+			Password: config.Password,
+		}), nil
+	case ModeSingle, "":
+		return redis.NewClient(&redis.Options{
+			Addr:     config.Addrs[0],
+			Password: config.Password,
+			DB:       config.DB,
+		}), nil
+	default:
+		return nil, fmt.Errorf("ttl_hash_set: unknown mode %q", config.Mode)
+	}
+}
+
+func (t *TTLHashSet) namespace(key string) string {
+	return t.prefix + ":" + key
+}
+
+// Add records key as seen, refreshing its TTL if it was already present.
+func (t *TTLHashSet) Add(key string) (bool, error) {
+	err := t.client.Set(context.Background(), t.namespace(key), true, t.ttl).Err()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// AddValue records value under key, like Add, but lets the value be read
+// back later with Value. Used for caching data shared across crawler
+// workers, such as a host's parsed robots.txt rules, rather than just
+// whether key has been seen.
+func (t *TTLHashSet) AddValue(key string, value string) error {
+	return t.client.Set(context.Background(), t.namespace(key), value, t.ttl).Err()
+}
+
+// Value returns the value previously stored under key with AddValue, and
+// whether key was found.
+func (t *TTLHashSet) Value(key string) (string, bool, error) {
+	value, err := t.client.Get(context.Background(), t.namespace(key)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Exists reports whether key has been Add()ed and not yet expired.
+func (t *TTLHashSet) Exists(key string) (bool, error) {
+	count, err := t.client.Exists(context.Background(), t.namespace(key)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// TTL returns the number of milliseconds left before key expires, or a
+// negative number if key doesn't exist (-2) or has no expiry (-1), per
+// Redis's PTTL semantics. go-redis represents those sentinels as -2ns/-1ns
+// rather than scaling them to milliseconds, so they're passed through
+// unchanged instead of being divided down to 0.
+func (t *TTLHashSet) TTL(key string) (int64, error) {
+	remaining, err := t.client.PTTL(context.Background(), t.namespace(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if remaining < 0 {
+		return int64(remaining), nil
+	}
+
+	return int64(remaining / time.Millisecond), nil
+}
+
+// Ping checks connectivity to the underlying Redis deployment.
+func (t *TTLHashSet) Ping() (string, error) {
+	return t.client.Ping(context.Background()).Result()
+}
+
+func (t *TTLHashSet) Close() error {
+	return t.client.Close()
+}
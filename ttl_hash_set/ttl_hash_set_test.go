@@ -6,31 +6,50 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"context"
 	"time"
 
 	"github.com/alphagov/govuk_crawler_worker/util"
-	"github.com/fzzy/radix/redis"
+	"github.com/go-redis/redis/v8"
 )
 
+func singleModeConfig(addr string) Config {
+	return Config{Mode: ModeSingle, Addrs: []string{addr}}
+}
+
 var _ = Describe("TTLHashSet", func() {
 	redisAddr := util.GetEnvDefault("REDIS_ADDRESS", "127.0.0.1:6379")
 	prefix := "govuk_mirror_crawler_test"
 
 	It("returns an error when asking for a TTLHashSet object that can't connect to redis", func() {
-		ttlHashSet, err := NewTTLHashSet(prefix, "127.0.0.1:20000")
+		ttlHashSet, err := NewTTLHashSet(prefix, singleModeConfig("127.0.0.1:20000"))
+
+		Expect(err).ToNot(BeNil())
+		Expect(ttlHashSet).To(BeNil())
+	})
+
+	It("returns an error when config.Addrs is empty", func() {
+		ttlHashSet, err := NewTTLHashSet(prefix, Config{Mode: ModeSingle})
 
 		Expect(err).ToNot(BeNil())
 		Expect(ttlHashSet).To(BeNil())
 	})
 
 	Describe("Reconnects", func() {
+		// go-redis keeps a pool of connections and dials a fresh one
+		// whenever a command can't use a pooled one, rather than
+		// maintaining radix's single persistent connection with its own
+		// reconnect goroutine. That means neither the exact error text
+		// nor the one-error-then-success cadence of a single persistent
+		// connection can be asserted here; these tests instead only rely
+		// on the pool eventually recovering once a working proxy exists.
 		var (
-			proxy         *util.ProxyTCP
-			proxyAddr     string = "127.0.0.1:6380"
-			key           string = "reconnect"
-			ttlHashSet    *TTLHashSet
-			reconnectTime time.Duration = 2 * time.Second
-			delayBetween  time.Duration = reconnectTime / 10
+			proxy        *util.ProxyTCP
+			proxyAddr    string = "127.0.0.1:6380"
+			key          string = "reconnect"
+			ttlHashSet   *TTLHashSet
+			waitFor      time.Duration = 2 * time.Second
+			pollInterval time.Duration = waitFor / 10
 		)
 
 		BeforeEach(func() {
@@ -40,7 +59,7 @@ var _ = Describe("TTLHashSet", func() {
 			Expect(err).To(BeNil())
 			Expect(proxy).ToNot(BeNil())
 
-			ttlHashSet, err = NewTTLHashSet(prefix, proxyAddr)
+			ttlHashSet, err = NewTTLHashSet(prefix, singleModeConfig(proxyAddr))
 
 			Expect(err).To(BeNil())
 			Expect(ttlHashSet).ToNot(BeNil())
@@ -56,54 +75,30 @@ var _ = Describe("TTLHashSet", func() {
 			_, _ = ttlHashSet.Add(key)
 
 			proxy.KillConnected()
-			exists, err := ttlHashSet.Exists(key)
 
-			Expect(err).ToNot(BeNil())
-			Expect(err.Error()).To(MatchRegexp("EOF|connection reset by peer"))
-			Expect(exists).To(Equal(false))
-
-			time.Sleep(delayBetween) // Allow other goroutine to reconnect.
-			exists, err = ttlHashSet.Exists(key)
-
-			Expect(err).To(BeNil())
-			Expect(exists).To(Equal(true))
+			Eventually(func() (bool, error) {
+				return ttlHashSet.Exists(key)
+			}, waitFor, pollInterval).Should(Equal(true))
 		})
 
-		It("should return errors until reconnected", func() {
+		It("should return errors until a working proxy is available again", func() {
 			_, _ = ttlHashSet.Add(key)
 			proxy.Close()
 
-			start := time.Now()
 			exists, err := ttlHashSet.Exists(key)
 
-			Expect(err.Error()).To(MatchRegexp("EOF|connection reset by peer"))
+			Expect(err).ToNot(BeNil())
 			Expect(exists).To(Equal(false))
 
-			time.Sleep(delayBetween) // Allow first reconnect to fail.
+			time.Sleep(pollInterval) // Allow the failed dial to be noticed.
 			proxy, err = util.NewProxyTCP(proxyAddr, redisAddr)
 
 			Expect(err).To(BeNil())
 			Expect(proxy).ToNot(BeNil())
 
-			errorCount := 0
-			for time.Since(start) < reconnectTime {
-				exists, err := ttlHashSet.Exists(key)
-
-				Expect(err).To(MatchError("use of closed network connection"))
-				Expect(exists).To(Equal(false))
-
-				time.Sleep(delayBetween)
-				errorCount++
-			}
-
-			// Subtract one for the error and sleep before we restart ProxyTCP.
-			expectedErrors := int((reconnectTime / delayBetween) - 1)
-			Expect(errorCount).To(BeNumerically("~", expectedErrors, 2))
-
-			exists, err = ttlHashSet.Exists(key)
-
-			Expect(err).To(BeNil())
-			Expect(exists).To(Equal(true))
+			Eventually(func() (bool, error) {
+				return ttlHashSet.Exists(key)
+			}, waitFor, pollInterval).Should(Equal(true))
 		})
 	})
 
@@ -114,7 +109,7 @@ var _ = Describe("TTLHashSet", func() {
 		)
 
 		BeforeEach(func() {
-			ttlHashSet, ttlHashSetErr = NewTTLHashSet(prefix, redisAddr)
+			ttlHashSet, ttlHashSetErr = NewTTLHashSet(prefix, singleModeConfig(redisAddr))
 		})
 
 		AfterEach(func() {
@@ -147,6 +142,26 @@ var _ = Describe("TTLHashSet", func() {
 			Expect(exists).To(Equal(true))
 		})
 
+		It("exposes a way of storing and retrieving a value under a key", func() {
+			key := "some.cached.value"
+
+			Expect(ttlHashSet.AddValue(key, "cached data")).To(BeNil())
+
+			value, ok, err := ttlHashSet.Value(key)
+
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(true))
+			Expect(value).To(Equal("cached data"))
+		})
+
+		It("reports a value isn't found when its key doesn't exist", func() {
+			value, ok, err := ttlHashSet.Value("this.key.does.not.exist")
+
+			Expect(err).To(BeNil())
+			Expect(ok).To(Equal(false))
+			Expect(value).To(Equal(""))
+		})
+
 		It("exposes a way to ping the underlying redis service", func() {
 			ping, err := ttlHashSet.Ping()
 
@@ -179,20 +194,19 @@ var _ = Describe("TTLHashSet", func() {
 })
 
 func purgeAllKeys(prefix string, address string) error {
-	client, err := redis.Dial("tcp", address)
-	if err != nil {
-		return err
-	}
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{Addr: address})
+	defer client.Close()
 
-	keys, err := client.Cmd("KEYS", prefix+"*").List()
+	keys, err := client.Keys(ctx, prefix+"*").Result()
 	if err != nil {
 		return err
 	}
 
-	reply := client.Cmd("DEL", keys)
-	if reply.Err != nil {
-		return reply.Err
+	if len(keys) == 0 {
+		return nil
 	}
 
-	return nil
+	return client.Del(ctx, keys...).Err()
 }